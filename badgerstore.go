@@ -18,46 +18,288 @@ package eventstore
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/oklog/ulid/v2"
-	"reflect"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// DefaultSubscriberBufferSize is the number of events buffered for a
+// Subscribe channel when BadgerEventStore.SubscriberBufferSize is unset.
+const DefaultSubscriberBufferSize = 64
+
+// metaKeySuffix marks the per-aggregate key that AppendExpected maintains
+// with the aggregate's current version, for a fast Version lookup.
+const metaKeySuffix = "__meta"
+
+// ErrSubscriberTooSlow is delivered to a Subscribe channel, as the final
+// event before it is closed, when the subscriber did not drain events fast
+// enough to keep its buffer from filling up.
+var ErrSubscriberTooSlow = errors.New("eventstore: subscriber buffer full, dropped")
+
+// ErrConcurrencyConflict is returned by AppendExpected when the aggregate's
+// current version does not match the expected version supplied by the caller.
+var ErrConcurrencyConflict = errors.New("eventstore: concurrency conflict, aggregate version does not match expected version")
+
 type BadgerEventStore struct {
 	RootDir                    string
 	MemoryOnly                 bool
 	EncryptionKey              []byte
 	EncryptionRotationDuration time.Duration
-	db                         *badger.DB
-	typeRegistery              map[string]reflect.Type
+	// SubscriberBufferSize overrides DefaultSubscriberBufferSize for Subscribe channels.
+	SubscriberBufferSize int
+	// CompactionThreshold, if non-zero, is the approximate number of events
+	// an aggregate may accumulate before Append/AppendExpected starts a
+	// background Compact down to its most recent Snapshot.
+	CompactionThreshold int
+	// Codec encodes and decodes event and snapshot content. Defaults to a
+	// GobCodec, matching the format this store used before Codec existed.
+	Codec        Codec
+	db           *badger.DB
+	subMu        sync.Mutex
+	subscribers  map[string][]*subscription
+	codecMu      sync.Mutex
+	decoders     map[string]Codec
+	writeLimiter *Limiter
+	readLimiter  *Limiter
+	compactMu    sync.Mutex
+	appendCounts map[string]int
+	compacting   map[string]bool
+}
+
+// Option configures a BadgerEventStore at construction, via MemoryStore or FileStore.
+type Option func(*BadgerEventStore)
+
+// WithWriteLimit caps Append/AppendExpected to bytesPerSec of record payload,
+// with bursts up to burst bytes, using a token bucket. This keeps a bursty
+// producer from overwhelming Badger's LSM compaction.
+func WithWriteLimit(bytesPerSec int64, burst int) Option {
+	return func(b *BadgerEventStore) {
+		b.writeLimiter = NewLimiter(bytesPerSec, burst)
+	}
+}
+
+// WithReadLimit caps ReadFrom/Subscribe replay to bytesPerSec of record
+// payload, with bursts up to burst bytes, using a token bucket.
+func WithReadLimit(bytesPerSec int64, burst int) Option {
+	return func(b *BadgerEventStore) {
+		b.readLimiter = NewLimiter(bytesPerSec, burst)
+	}
+}
+
+// subscription is a single Subscribe call's delivery channel. While
+// replaying is true, deliver queues live events instead of sending them to
+// ch, so the replay goroutine's backlog is always drained to the channel
+// before any live event, keeping delivery in order and duplicate-free.
+type subscription struct {
+	ch     chan Event
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	replaying bool
+	queue     []Event
+}
+
+// deliver hands event to the subscriber, queueing it if a replay is still in
+// progress. It reports whether the subscriber fell behind and must be
+// dropped.
+func (s *subscription) deliver(event Event) (dropped bool) {
+	s.mu.Lock()
+	if s.replaying {
+		if len(s.queue) >= cap(s.ch) {
+			s.mu.Unlock()
+			select {
+			case s.ch <- Event{Err: ErrSubscriberTooSlow}:
+			default:
+			}
+			return true
+		}
+		s.queue = append(s.queue, event)
+		s.mu.Unlock()
+		return false
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.ch <- event:
+		return false
+	default:
+		select {
+		case s.ch <- Event{Err: ErrSubscriberTooSlow}:
+		default:
+		}
+		return true
+	}
+}
+
+// endReplay returns any live events that arrived while the replay was still
+// running, for the replay goroutine to flush to ch in the order they were
+// published. It marks the subscription as caught up only once the queue is
+// empty, so the caller repeats it until it returns no events.
+func (s *subscription) endReplay() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := s.queue
+	s.queue = nil
+	if len(queued) == 0 {
+		s.replaying = false
+	}
+	return queued
 }
 
 type Record struct {
 	Id        ulid.ULID
 	Timestamp time.Time
 	Type      string
+	Codec     string
 	Content   []byte
 }
 
-func MemoryStore() EventStore {
-	return &BadgerEventStore{
-		MemoryOnly:    true,
-		RootDir:       "",
-		typeRegistery: make(map[string]reflect.Type),
+// marshalRecord packs a Record into a compact binary envelope: the ULID and
+// timestamp as fixed-width fields, followed by the length-prefixed Type,
+// Codec and Content. This keeps Content exactly as Codec.Marshal produced
+// it, rather than re-encoding it (e.g. base64, inside JSON) a second time.
+func marshalRecord(r Record) ([]byte, error) {
+	idBytes, err := r.Id.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(idBytes)+8+4+len(r.Type)+4+len(r.Codec)+4+len(r.Content))
+	buf = append(buf, idBytes...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(r.Timestamp.UnixNano()))
+	buf = appendLengthPrefixed(buf, []byte(r.Type))
+	buf = appendLengthPrefixed(buf, []byte(r.Codec))
+	buf = appendLengthPrefixed(buf, r.Content)
+	return buf, nil
+}
+
+// unmarshalRecord decodes a Record envelope written by marshalRecord, or a
+// JSON envelope written before it existed.
+func unmarshalRecord(data []byte) (Record, error) {
+	var record Record
+
+	// A binary envelope starts with a ULID timestamp byte, which cannot be
+	// '{' for any time before the year 6000.
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &record); err != nil {
+			return Record{}, err
+		}
+		return record, nil
+	}
+
+	if len(data) < 16 {
+		return Record{}, fmt.Errorf("eventstore: truncated record envelope")
+	}
+	if err := record.Id.UnmarshalBinary(data[:16]); err != nil {
+		return Record{}, err
+	}
+	data = data[16:]
+
+	if len(data) < 8 {
+		return Record{}, fmt.Errorf("eventstore: truncated record envelope")
+	}
+	record.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(data))).UTC()
+	data = data[8:]
+
+	typeBytes, data, err := takeLengthPrefixed(data)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Type = string(typeBytes)
+
+	codecBytes, data, err := takeLengthPrefixed(data)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Codec = string(codecBytes)
+
+	content, _, err := takeLengthPrefixed(data)
+	if err != nil {
+		return Record{}, err
+	}
+	record.Content = content
+
+	return record, nil
+}
+
+// appendLengthPrefixed appends b to buf preceded by its length as a uint32.
+func appendLengthPrefixed(buf []byte, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+// takeLengthPrefixed reads a length-prefixed field written by
+// appendLengthPrefixed, returning the field and the remaining bytes.
+func takeLengthPrefixed(data []byte) (field []byte, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("eventstore: truncated record envelope")
+	}
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(len(data)) < uint64(n) {
+		return nil, nil, fmt.Errorf("eventstore: truncated record envelope")
+	}
+	return data[:n], data[n:], nil
+}
+
+func MemoryStore(opts ...Option) EventStore {
+	store := &BadgerEventStore{
+		MemoryOnly:  true,
+		RootDir:     "",
+		subscribers: make(map[string][]*subscription),
+	}
+
+	for _, opt := range opts {
+		opt(store)
 	}
+
+	return store
 }
 
-func FileStore(path string, key []byte, rotationDur time.Duration) EventStore {
-	return &BadgerEventStore{
+func FileStore(path string, key []byte, rotationDur time.Duration, opts ...Option) EventStore {
+	store := &BadgerEventStore{
 		RootDir:                    path,
 		MemoryOnly:                 false,
 		EncryptionKey:              key,
 		EncryptionRotationDuration: rotationDur,
-		typeRegistery:              make(map[string]reflect.Type),
+		subscribers:                make(map[string][]*subscription),
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	return store
+}
+
+// Stats reports current throughput for the write and read token buckets
+// configured via WithWriteLimit/WithReadLimit. A direction with no limiter
+// configured always reports zero values.
+type Stats struct {
+	WriteEMABytesPerSec float64
+	WritePending        int64
+	ReadEMABytesPerSec  float64
+	ReadPending         int64
+}
+
+// Stats returns the store's current write and read limiter throughput.
+func (b *BadgerEventStore) Stats() Stats {
+	write := b.writeLimiter.Stats()
+	read := b.readLimiter.Stats()
+
+	return Stats{
+		WriteEMABytesPerSec: write.EMARate,
+		WritePending:        write.Pending,
+		ReadEMABytesPerSec:  read.EMARate,
+		ReadPending:         read.Pending,
 	}
 }
 
@@ -85,21 +327,32 @@ func (b *BadgerEventStore) kvstore() (*badger.DB, error) {
 }
 
 func (b *BadgerEventStore) Append(aggregate string, content interface{}) error {
+	return b.appendWithCtx(context.Background(), aggregate, content)
+}
+
+// AppendCtx is Append, but honoring ctx while it waits on a configured write
+// rate limit instead of blocking unconditionally.
+func (b *BadgerEventStore) AppendCtx(ctx context.Context, aggregate string, content interface{}) error {
+	return b.appendWithCtx(ctx, aggregate, content)
+}
+
+func (b *BadgerEventStore) appendWithCtx(ctx context.Context, aggregate string, content interface{}) error {
 	now := time.Now().UTC()
+	codec := b.activeCodec()
 
 	record := Record{
 		Id:        NewId(now),
 		Timestamp: now,
 		Type:      typeName(content),
+		Codec:     codec.Name(),
 	}
 
-	var c bytes.Buffer
-	enc := gob.NewEncoder(&c)
-	if err := enc.Encode(&content); err != nil {
+	encoded, err := codec.Marshal(content)
+	if err != nil {
 		return err
 	}
 
-	record.Content = c.Bytes()
+	record.Content = encoded
 
 	k, err := record.Id.MarshalText()
 	if err != nil {
@@ -107,11 +360,15 @@ func (b *BadgerEventStore) Append(aggregate string, content interface{}) error {
 	}
 
 	key := []byte(fmt.Sprintf("%s:%s", aggregate, k))
-	value, err := json.Marshal(record)
+	value, err := marshalRecord(record)
 	if err != nil {
 		return err
 	}
 
+	if err := b.writeLimiter.Wait(ctx, len(value)); err != nil {
+		return err
+	}
+
 	db, err := b.kvstore()
 	if err != nil {
 		return err
@@ -123,58 +380,381 @@ func (b *BadgerEventStore) Append(aggregate string, content interface{}) error {
 		return err
 	}
 
-	// FIXME: This shouldn't be necessary, but writes in rapid succession can fail otherwise. (i.e. in unit tests)
-	// time.Sleep(1 * time.Millisecond)
+	b.publish(aggregate, record, content)
+	b.maybeCompact(aggregate)
 
 	return nil
 }
 
+// appendedEvent pairs a committed Record with its decoded content so
+// AppendExpected can fan events out to subscribers after its transaction
+// commits.
+type appendedEvent struct {
+	record  Record
+	content interface{}
+}
+
+// preparedEvent is an event's encoded Record and its Badger key, built ahead
+// of time so AppendExpected only needs to Set it inside the transaction.
+type preparedEvent struct {
+	key   []byte
+	value []byte
+	appendedEvent
+}
+
+// AppendExpected appends events to aggregate inside a single Badger
+// transaction, first reading its meta key to confirm the current version
+// matches expectedVersion. Event keys embed a monotonically increasing
+// sequence (aggregate:seq:ULID) so the highest one present is the
+// aggregate's version, and that version is also mirrored into the meta key
+// for Version, and this check, to read without a scan — which matters once
+// Compact has deleted the events a scan would otherwise need.
+func (b *BadgerEventStore) AppendExpected(aggregate string, expectedVersion uint64, events ...interface{}) (uint64, error) {
+	return b.appendExpectedWithCtx(context.Background(), aggregate, expectedVersion, events...)
+}
+
+// AppendExpectedCtx is AppendExpected, but honoring ctx while it waits on a
+// configured write rate limit instead of blocking unconditionally.
+func (b *BadgerEventStore) AppendExpectedCtx(ctx context.Context, aggregate string, expectedVersion uint64, events ...interface{}) (uint64, error) {
+	return b.appendExpectedWithCtx(ctx, aggregate, expectedVersion, events...)
+}
+
+func (b *BadgerEventStore) appendExpectedWithCtx(ctx context.Context, aggregate string, expectedVersion uint64, events ...interface{}) (uint64, error) {
+	db, err := b.kvstore()
+	if err != nil {
+		return 0, err
+	}
+
+	codec := b.activeCodec()
+	version := expectedVersion
+	prepared := make([]preparedEvent, 0, len(events))
+	var totalBytes int
+
+	for _, content := range events {
+		version++
+
+		now := time.Now().UTC()
+		record := Record{
+			Id:        NewId(now),
+			Timestamp: now,
+			Type:      typeName(content),
+			Codec:     codec.Name(),
+		}
+
+		encoded, err := codec.Marshal(content)
+		if err != nil {
+			return 0, err
+		}
+		record.Content = encoded
+
+		key, err := seqKey(aggregate, version, record.Id)
+		if err != nil {
+			return 0, err
+		}
+
+		value, err := marshalRecord(record)
+		if err != nil {
+			return 0, err
+		}
+
+		prepared = append(prepared, preparedEvent{
+			key:           key,
+			value:         value,
+			appendedEvent: appendedEvent{record: record, content: content},
+		})
+		totalBytes += len(value)
+	}
+
+	// Wait for the whole batch's tokens before opening the transaction, so a
+	// rate-limited wait never holds a Badger write transaction open, and
+	// honor ctx rather than blocking unconditionally.
+	if err := b.writeLimiter.Wait(ctx, totalBytes); err != nil {
+		return 0, err
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		current, err := b.currentVersion(txn, aggregate)
+		if err != nil {
+			return err
+		}
+		if current != expectedVersion {
+			return ErrConcurrencyConflict
+		}
+
+		for _, p := range prepared {
+			if err := txn.Set(p.key, p.value); err != nil {
+				return err
+			}
+		}
+
+		return txn.Set(metaKey(aggregate), []byte(strconv.FormatUint(version, 10)))
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range prepared {
+		b.publish(aggregate, p.record, p.content)
+	}
+	b.maybeCompact(aggregate)
+
+	return version, nil
+}
+
+// Version returns the aggregate's current version as maintained by
+// AppendExpected, without scanning its event history.
+func (b *BadgerEventStore) Version(aggregate string) (uint64, error) {
+	db, err := b.kvstore()
+	if err != nil {
+		return 0, err
+	}
+
+	var version uint64
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(metaKey(aggregate))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			v, err := strconv.ParseUint(string(val), 10, 64)
+			if err != nil {
+				return err
+			}
+			version = v
+			return nil
+		})
+	})
+
+	return version, err
+}
+
+func metaKey(aggregate string) []byte {
+	return []byte(fmt.Sprintf("%s:%s", aggregate, metaKeySuffix))
+}
+
+func isMetaKey(key []byte) bool {
+	return bytes.HasSuffix(key, []byte(":"+metaKeySuffix))
+}
+
+// seqKey builds an event key with the sequence zero-padded so that lexical
+// key order matches numeric sequence order.
+func seqKey(aggregate string, seq uint64, id ulid.ULID) ([]byte, error) {
+	text, err := id.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s:%020d:%s", aggregate, seq, text)), nil
+}
+
+// currentVersion returns the aggregate's version for AppendExpected's
+// concurrency check. It reads the meta key AppendExpected maintains, which
+// stays correct even after Compact has deleted the aggregate's event keys,
+// and only falls back to scanning those keys for an aggregate that predates
+// AppendExpected and so has no meta key yet.
+func (b *BadgerEventStore) currentVersion(txn *badger.Txn, aggregate string) (uint64, error) {
+	item, err := txn.Get(metaKey(aggregate))
+	if err == badger.ErrKeyNotFound {
+		return b.highestSequence(txn, aggregate)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var version uint64
+	err = item.Value(func(val []byte) error {
+		v, err := strconv.ParseUint(string(val), 10, 64)
+		if err != nil {
+			return err
+		}
+		version = v
+		return nil
+	})
+	return version, err
+}
+
+// highestSequence scans the aggregate's key prefix in reverse and returns
+// the highest sequence number embedded by AppendExpected, or 0 if the
+// aggregate has no sequenced events yet.
+func (b *BadgerEventStore) highestSequence(txn *badger.Txn, aggregate string) (uint64, error) {
+	prefix := []byte(aggregate + ":")
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	// Reverse iteration seeks to the largest key <= seekKey, so appending a
+	// high byte guarantees we start after every real key for this prefix.
+	seekKey := append(append([]byte{}, prefix...), 0xff)
+
+	for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
+		key := it.Item().Key()
+		if isMetaKey(key) {
+			continue
+		}
+
+		seq, err := parseSeq(aggregate, key)
+		if err != nil {
+			// Pre-AppendExpected key with no embedded sequence; older
+			// aggregates are treated as version 0.
+			continue
+		}
+		return seq, nil
+	}
+
+	return 0, nil
+}
+
+// parseSeq extracts the sequence segment from an "aggregate:seq:ULID" key.
+func parseSeq(aggregate string, key []byte) (uint64, error) {
+	rest := key[len(aggregate)+1:]
+	idx := bytes.IndexByte(rest, ':')
+	if idx < 0 {
+		return 0, fmt.Errorf("eventstore: key missing sequence segment: %s", key)
+	}
+	return strconv.ParseUint(string(rest[:idx]), 10, 64)
+}
+
+// Register makes t decodable by the active Codec, if that codec keeps its
+// own type registry (GobCodec and JSONCodec do; ProtoCodec uses
+// RegisterFactory instead).
 func (b *BadgerEventStore) Register(t interface{}) {
-	gob.Register(t)
-	name := typeName(t)
-	b.typeRegistery[name] = reflect.TypeOf(t)
+	codec := b.activeCodec()
+	if r, ok := codec.(interface{ Register(t interface{}) }); ok {
+		r.Register(t)
+	}
 }
 
 func typeName(t interface{}) string {
 	return fmt.Sprintf("%T", t)
 }
 
-func (b *BadgerEventStore) makeInstance(name string) interface{} {
-	return reflect.New(b.typeRegistery[name]).Elem().Interface()
+// activeCodec returns the codec Append/AppendExpected/Snapshot encode with,
+// defaulting to a GobCodec, and remembers it so decodeRecord can still find
+// it by name after Codec is later swapped for a migration.
+func (b *BadgerEventStore) activeCodec() Codec {
+	if b.Codec == nil {
+		b.Codec = NewGobCodec()
+	}
+	b.rememberCodec(b.Codec)
+	return b.Codec
 }
 
-func (b *BadgerEventStore) Read(aggregate string) ([]interface{}, error) {
-	db, err := b.kvstore()
+func (b *BadgerEventStore) rememberCodec(codec Codec) {
+	b.codecMu.Lock()
+	defer b.codecMu.Unlock()
+
+	if b.decoders == nil {
+		b.decoders = make(map[string]Codec)
+	}
+	b.decoders[codec.Name()] = codec
+}
+
+// decoderFor finds the codec that can decode a record written under the
+// given codec name. Records written before Codec existed have no name
+// recorded, and are treated as gob, the format this store hardcoded then.
+func (b *BadgerEventStore) decoderFor(name string) (Codec, error) {
+	if name == "" {
+		name = gobCodecName
+	}
 
+	b.codecMu.Lock()
+	defer b.codecMu.Unlock()
+
+	codec, ok := b.decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("eventstore: no codec registered to decode records written with %q", name)
+	}
+	return codec, nil
+}
+
+// decodeRecord unmarshals a raw Badger value into its Record envelope and
+// decodes its content with the codec named in the record's header.
+func (b *BadgerEventStore) decodeRecord(val []byte) (Record, interface{}, error) {
+	record, err := unmarshalRecord(val)
 	if err != nil {
-		return nil, err
+		return record, nil, err
+	}
+
+	codec, err := b.decoderFor(record.Codec)
+	if err != nil {
+		return record, nil, err
+	}
+
+	v, err := codec.Unmarshal(record.Content, record.Type)
+	if err != nil {
+		return record, nil, err
+	}
+
+	return record, v, nil
+}
+
+// ReadFrom reads an aggregate's events. When sinceSnapshot is true it locates
+// the Snapshot with the greatest uptoID and seeks past it, so only the events appended after it are decoded, avoiding the full
+// O(N) decode a long-lived aggregate would otherwise require.
+func (b *BadgerEventStore) ReadFrom(aggregate string, sinceSnapshot bool) (interface{}, []interface{}, error) {
+	db, err := b.kvstore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshot interface{}
+	var uptoID ulid.ULID
+	haveSnapshot := false
+
+	if sinceSnapshot {
+		if err := db.View(func(txn *badger.Txn) error {
+			record, v, ok, err := b.latestSnapshot(txn, aggregate)
+			if err != nil || !ok {
+				return err
+			}
+
+			snapshot, uptoID, haveSnapshot = v, record.Id, true
+			return nil
+		}); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	prefix := []byte(aggregate + ":")
-	var values []interface{}
+	var events []interface{}
 
 	if err = db.View(func(txn *badger.Txn) error {
+		seekKey := prefix
+		if haveSnapshot {
+			var err error
+			seekKey, err = b.seekKeyAfterEvent(txn, aggregate, uptoID)
+			if err != nil {
+				return err
+			}
+		}
+
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 
-		// Walk all the events using the aggregate as a prefix
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
+			if isMetaKey(item.Key()) {
+				continue
+			}
 
 			err := item.Value(func(val []byte) error {
-				var record Record
-				if err = json.Unmarshal(val, &record); err != nil {
+				if err := b.readLimiter.Wait(context.Background(), len(val)); err != nil {
 					return err
 				}
 
-				c := bytes.NewReader(record.Content)
-				dec := gob.NewDecoder(c)
-				v := b.makeInstance(record.Type)
-				if err = dec.Decode(&v); err != nil {
+				_, v, err := b.decodeRecord(val)
+				if err != nil {
 					return err
 				}
 
-				values = append(values, v)
+				events = append(events, v)
 				return nil
 			})
 
@@ -184,10 +764,425 @@ func (b *BadgerEventStore) Read(aggregate string) ([]interface{}, error) {
 		}
 		return nil
 	}); err != nil {
+		return nil, nil, err
+	}
+
+	return snapshot, events, nil
+}
+
+// seekKeyAfterEvent returns the key to Seek to in order to resume decoding
+// with the first event strictly after uptoID, without decoding any event at
+// or before it. Event keys embed their ULID in their trailing
+// ulid.EncodedSize bytes regardless of whether Append or AppendExpected
+// wrote them, so this only needs one pass comparing keys with
+// PrefetchValues disabled, rather than decoding every record just to
+// compare its Id.
+func (b *BadgerEventStore) seekKeyAfterEvent(txn *badger.Txn, aggregate string, uptoID ulid.ULID) ([]byte, error) {
+	prefix := []byte(aggregate + ":")
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key := it.Item().Key()
+		if isMetaKey(key) {
+			continue
+		}
+
+		id, err := eventIDFromKey(key)
+		if err != nil {
+			continue
+		}
+
+		if id.Compare(uptoID) > 0 {
+			return append([]byte{}, key...), nil
+		}
+	}
+
+	// Every event is at or before the snapshot; nothing left to decode.
+	return append(append([]byte{}, prefix...), 0xff), nil
+}
+
+// eventIDFromKey extracts the ULID embedded at the end of an event key,
+// regardless of whether it was written by Append ("aggregate:ULID") or
+// AppendExpected ("aggregate:seq:ULID") — both end in the ULID's fixed
+// ulid.EncodedSize-byte text encoding.
+func eventIDFromKey(key []byte) (ulid.ULID, error) {
+	if len(key) < ulid.EncodedSize {
+		return ulid.ULID{}, fmt.Errorf("eventstore: key too short to contain a ULID: %s", key)
+	}
+	return ulid.ParseStrict(string(key[len(key)-ulid.EncodedSize:]))
+}
+
+// Snapshot stores a point-in-time aggregate state under a distinct key
+// prefix, encoded with the same registered-type mechanism as events, so
+// ReadFrom and Compact can treat it as the aggregate's new starting point.
+func (b *BadgerEventStore) Snapshot(aggregate string, state interface{}, uptoID ulid.ULID) error {
+	codec := b.activeCodec()
+
+	record := Record{
+		Id:        uptoID,
+		Timestamp: time.Now().UTC(),
+		Type:      typeName(state),
+		Codec:     codec.Name(),
+	}
+
+	encoded, err := codec.Marshal(state)
+	if err != nil {
+		return err
+	}
+	record.Content = encoded
+
+	idText, err := uptoID.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	value, err := marshalRecord(record)
+	if err != nil {
+		return err
+	}
+
+	db, err := b.kvstore()
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(snapshotKey(aggregate, idText), value)
+	})
+}
+
+// Compact deletes events for an aggregate at or before keepAfter. Deletes
+// are issued through a WriteBatch, which spreads them across as many
+// transactions as needed, rather than one db.Update, since a long-lived
+// aggregate can easily hold more keys than fit in a single Badger
+// transaction (ErrTxnTooBig) — precisely the aggregates this feature
+// targets.
+func (b *BadgerEventStore) Compact(aggregate string, keepAfter ulid.ULID) error {
+	db, err := b.kvstore()
+	if err != nil {
+		return err
+	}
+
+	prefix := []byte(aggregate + ":")
+	var toDelete [][]byte
+
+	if err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().Key()
+			if isMetaKey(key) {
+				continue
+			}
+
+			id, err := eventIDFromKey(key)
+			if err != nil {
+				return err
+			}
+			if id.Compare(keepAfter) <= 0 {
+				toDelete = append(toDelete, append([]byte{}, key...))
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, key := range toDelete {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return wb.Flush()
+}
+
+// maybeCompact starts a background Compact for aggregate once its appends
+// since the last compaction attempt cross CompactionThreshold, trimming
+// everything at or before the most recent Snapshot. It is a no-op until
+// CompactionThreshold is set and at least one Snapshot exists for the
+// aggregate. The append count is an in-memory counter rather than a rescan
+// of the aggregate's keys, so this stays cheap on the Append hot path, and
+// at most one Compact runs per aggregate at a time.
+func (b *BadgerEventStore) maybeCompact(aggregate string) {
+	if b.CompactionThreshold <= 0 {
+		return
+	}
+
+	if !b.startCompaction(aggregate) {
+		return
+	}
+
+	db, err := b.kvstore()
+	if err != nil {
+		b.endCompaction(aggregate)
+		return
+	}
+
+	go func() {
+		defer b.endCompaction(aggregate)
+
+		var uptoID ulid.ULID
+		haveSnapshot := false
+
+		if err := db.View(func(txn *badger.Txn) error {
+			record, _, ok, err := b.latestSnapshot(txn, aggregate)
+			if err != nil || !ok {
+				return err
+			}
+			uptoID, haveSnapshot = record.Id, true
+			return nil
+		}); err != nil || !haveSnapshot {
+			return
+		}
+
+		_ = b.Compact(aggregate, uptoID)
+	}()
+}
+
+// startCompaction counts an append toward aggregate's compaction trigger and
+// reports whether this call should start a Compact: the threshold has been
+// crossed and no Compact is already running for this aggregate. It resets
+// the counter either way so a busy aggregate isn't rescanned on every call.
+func (b *BadgerEventStore) startCompaction(aggregate string) bool {
+	b.compactMu.Lock()
+	defer b.compactMu.Unlock()
+
+	if b.appendCounts == nil {
+		b.appendCounts = make(map[string]int)
+	}
+	b.appendCounts[aggregate]++
+
+	if b.appendCounts[aggregate] < b.CompactionThreshold {
+		return false
+	}
+	b.appendCounts[aggregate] = 0
+
+	if b.compacting == nil {
+		b.compacting = make(map[string]bool)
+	}
+	if b.compacting[aggregate] {
+		return false
+	}
+	b.compacting[aggregate] = true
+	return true
+}
+
+// endCompaction releases the compaction lock startCompaction took for aggregate.
+func (b *BadgerEventStore) endCompaction(aggregate string) {
+	b.compactMu.Lock()
+	delete(b.compacting, aggregate)
+	b.compactMu.Unlock()
+}
+
+// latestSnapshot returns the aggregate's Snapshot with the greatest uptoID,
+// if one exists. That uptoID is not compared with the aggregate's events.
+func (b *BadgerEventStore) latestSnapshot(txn *badger.Txn, aggregate string) (Record, interface{}, bool, error) {
+	prefix := snapshotPrefix(aggregate)
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	// Reverse iteration seeks to the largest key <= seekKey, so appending a
+	// high byte guarantees we start at the newest snapshot for this prefix.
+	seekKey := append(append([]byte{}, prefix...), 0xff)
+	it.Seek(seekKey)
+	if !it.ValidForPrefix(prefix) {
+		return Record{}, nil, false, nil
+	}
+
+	var record Record
+	var value interface{}
+	err := it.Item().Value(func(val []byte) error {
+		r, v, err := b.decodeRecord(val)
+		if err != nil {
+			return err
+		}
+		record, value = r, v
+		return nil
+	})
+
+	return record, value, err == nil, err
+}
+
+func snapshotKey(aggregate string, idText []byte) []byte {
+	return []byte(fmt.Sprintf("snap:%s:%s", aggregate, idText))
+}
+
+func snapshotPrefix(aggregate string) []byte {
+	return []byte(fmt.Sprintf("snap:%s:", aggregate))
+}
+
+// Subscribe replays any records for aggregate with keys strictly greater
+// than fromID, then delivers newly appended events as Append fans them out.
+// The returned channel is closed once ctx is cancelled, the store is
+// closed, or the subscriber is dropped for falling behind.
+func (b *BadgerEventStore) Subscribe(ctx context.Context, aggregate string, fromID ulid.ULID) (<-chan Event, error) {
+	db, err := b.kvstore()
+	if err != nil {
+		return nil, err
+	}
+
+	bufSize := b.SubscriberBufferSize
+	if bufSize <= 0 {
+		bufSize = DefaultSubscriberBufferSize
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := &subscription{
+		ch:        make(chan Event, bufSize),
+		cancel:    cancel,
+		replaying: true,
+	}
+
+	marker, err := fromID.MarshalText()
+	if err != nil {
+		cancel()
+		close(sub.ch)
 		return nil, err
 	}
 
-	return values, nil
+	prefix := []byte(aggregate + ":")
+	seekKey := append(append([]byte{}, prefix...), marker...)
+
+	// The replay transaction is opened before the subscriber is registered,
+	// so its snapshot can never include an event published afterward: every
+	// live event is therefore delivered exactly once, never also replayed.
+	txn := db.NewTransaction(false)
+
+	b.addSubscriber(aggregate, sub)
+
+	go func() {
+		defer txn.Discard()
+
+		replayErr := func() error {
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				if bytes.Equal(item.Key(), seekKey) || isMetaKey(item.Key()) {
+					continue
+				}
+
+				err := item.Value(func(val []byte) error {
+					if err := b.readLimiter.Wait(subCtx, len(val)); err != nil {
+						return nil
+					}
+
+					record, v, err := b.decodeRecord(val)
+					if err != nil {
+						return err
+					}
+
+					select {
+					case sub.ch <- Event{Id: record.Id, Content: v}:
+					case <-subCtx.Done():
+					}
+					return nil
+				})
+
+				if err != nil {
+					return err
+				}
+
+				if subCtx.Err() != nil {
+					return nil
+				}
+			}
+			return nil
+		}()
+
+		if replayErr != nil {
+			select {
+			case sub.ch <- Event{Err: replayErr}:
+			case <-subCtx.Done():
+			}
+		}
+
+		// Flush whatever live events queued up while the replay above was
+		// still running, in the order they were published, before deliver
+		// ever sends straight to ch.
+		for queued := sub.endReplay(); len(queued) > 0; queued = sub.endReplay() {
+			if replayErr != nil {
+				continue
+			}
+			for _, event := range queued {
+				select {
+				case sub.ch <- event:
+				case <-subCtx.Done():
+				}
+				if subCtx.Err() != nil {
+					break
+				}
+			}
+		}
+
+		<-subCtx.Done()
+		b.removeSubscriber(aggregate, sub)
+		close(sub.ch)
+	}()
+
+	return sub.ch, nil
+}
+
+func (b *BadgerEventStore) addSubscriber(aggregate string, sub *subscription) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[string][]*subscription)
+	}
+	b.subscribers[aggregate] = append(b.subscribers[aggregate], sub)
+}
+
+func (b *BadgerEventStore) removeSubscriber(aggregate string, sub *subscription) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	subs := b.subscribers[aggregate]
+	for i, s := range subs {
+		if s == sub {
+			b.subscribers[aggregate] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+}
+
+// publish fans the just-appended record out to every live subscriber of
+// aggregate. A subscriber whose buffer is full is dropped with
+// ErrSubscriberTooSlow rather than allowed to stall Append.
+func (b *BadgerEventStore) publish(aggregate string, record Record, content interface{}) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	subs := b.subscribers[aggregate]
+	if len(subs) == 0 {
+		return
+	}
+
+	event := Event{Id: record.Id, Content: content}
+	remaining := subs[:0]
+	for _, sub := range subs {
+		if sub.deliver(event) {
+			sub.cancel()
+			continue
+		}
+		remaining = append(remaining, sub)
+	}
+	b.subscribers[aggregate] = remaining
 }
 
 func (b *BadgerEventStore) ListKeys() ([]string, error) {
@@ -237,7 +1232,6 @@ func (b *BadgerEventStore) ListKeysForAggregate(aggregate string) ([]string, err
 			keys = append(keys, string(item.Key()))
 		}
 
-		time.Sleep(1 * time.Millisecond)
 		return nil
 	}); err != nil {
 		return nil, err
@@ -247,6 +1241,15 @@ func (b *BadgerEventStore) ListKeysForAggregate(aggregate string) ([]string, err
 }
 
 func (b *BadgerEventStore) Close() error {
+	b.subMu.Lock()
+	for _, subs := range b.subscribers {
+		for _, sub := range subs {
+			sub.cancel()
+		}
+	}
+	b.subscribers = nil
+	b.subMu.Unlock()
+
 	if b.db != nil {
 		if err := b.db.Close(); err != nil {
 			return err
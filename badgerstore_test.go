@@ -17,9 +17,15 @@
 package eventstore
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
 func TestBadgerEventStore_Append(t *testing.T) {
@@ -38,7 +44,7 @@ func TestBadgerEventStore_Append(t *testing.T) {
 		t.Error(err)
 	}
 
-	results, err := store.Read(fact)
+	_, results, err := store.ReadFrom(fact, false)
 	if err != nil {
 		t.Error(err)
 		return
@@ -90,7 +96,7 @@ func TestBadgerEventStore_AppendWithMultipleFacts(t *testing.T) {
 		}
 	}
 
-	results1, err := store.Read(fact1)
+	_, results1, err := store.ReadFrom(fact1, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -100,7 +106,7 @@ func TestBadgerEventStore_AppendWithMultipleFacts(t *testing.T) {
 		t.Errorf("Incorrect number of events: %d", len(results1))
 	}
 
-	results2, err := store.Read(fact2)
+	_, results2, err := store.ReadFrom(fact2, false)
 	if err != nil {
 		t.Error(err)
 	}
@@ -119,3 +125,650 @@ func TestBadgerEventStore_AppendWithMultipleFacts(t *testing.T) {
 		fmt.Println(k)
 	}
 }
+
+func TestBadgerEventStore_AppendExpected(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.concurrency"
+
+	version, err := store.Version(fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Fatalf("expected a new aggregate to start at version 0, got %d", version)
+	}
+
+	version, err = store.AppendExpected(fact, version, Test{Value: 1}, Test{Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Fatalf("expected version 2 after two events, got %d", version)
+	}
+
+	if _, err := store.AppendExpected(fact, 0, Test{Value: 3}); !errors.Is(err, ErrConcurrencyConflict) {
+		t.Fatalf("expected ErrConcurrencyConflict for a stale expected version, got %v", err)
+	}
+
+	version, err = store.AppendExpected(fact, version, Test{Value: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Fatalf("expected version 3 after a third event, got %d", version)
+	}
+
+	if v, err := store.Version(fact); err != nil || v != 3 {
+		t.Fatalf("expected Version to report 3, got %d, %v", v, err)
+	}
+
+	_, results, err := store.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 events from Read, got %d", len(results))
+	}
+}
+
+func TestBadgerEventStore_AppendExpectedAfterCompact(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.expected.compact"
+
+	version, err := store.AppendExpected(fact, 0, Test{Value: 1}, Test{Value: 2}, Test{Value: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Fatalf("expected version 3 after three events, got %d", version)
+	}
+
+	keys, err := store.ListKeysForAggregate(fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last string
+	for _, k := range keys {
+		if !isMetaKey([]byte(k)) {
+			last = k
+		}
+	}
+	uptoID, err := ulid.ParseStrict(last[len(last)-26:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Snapshot(fact, Test{Value: 3}, uptoID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Compact(fact, uptoID); err != nil {
+		t.Fatal(err)
+	}
+
+	// highestSequence alone would now see no event keys and report version
+	// 0; AppendExpected must still honor the true version 3 from the meta
+	// key so this call succeeds instead of returning ErrConcurrencyConflict.
+	version, err = store.AppendExpected(fact, version, Test{Value: 4})
+	if err != nil {
+		t.Fatalf("expected AppendExpected to succeed against the post-compaction version, got %v", err)
+	}
+	if version != 4 {
+		t.Fatalf("expected version 4 after a fourth event, got %d", version)
+	}
+
+	if v, err := store.Version(fact); err != nil || v != 4 {
+		t.Fatalf("expected Version to report 4, got %d, %v", v, err)
+	}
+}
+
+func TestBadgerEventStore_WriteLimit(t *testing.T) {
+	store := MemoryStore(WithWriteLimit(1, 1)).(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.limit"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := store.AppendCtx(ctx, fact, Test{Value: 2}); err == nil {
+		t.Error("expected AppendCtx to respect ctx while waiting on an exhausted write limit")
+	}
+
+	stats := store.Stats()
+	if stats.WriteEMABytesPerSec <= 0 {
+		t.Errorf("expected a positive write EMA after at least one append, got %v", stats.WriteEMABytesPerSec)
+	}
+}
+
+func TestBadgerEventStore_AppendExpectedCtxRespectsWriteLimit(t *testing.T) {
+	store := MemoryStore(WithWriteLimit(1, 1)).(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.expected.limit"
+
+	version, err := store.AppendExpected(fact, 0, Test{Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := store.AppendExpectedCtx(ctx, fact, version, Test{Value: 2}); err == nil {
+		t.Error("expected AppendExpectedCtx to respect ctx while waiting on an exhausted write limit")
+	}
+
+	if v, err := store.Version(fact); err != nil || v != version {
+		t.Fatalf("expected the aggregate version to be unchanged by the cancelled append, got %d, %v", v, err)
+	}
+}
+
+func TestBadgerEventStore_RecordEnvelopeDoesNotReencodeContent(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	store.Codec = NewJSONCodec()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	content := Test{Value: 1}
+
+	record := Record{
+		Id:        NewId(time.Now().UTC()),
+		Timestamp: time.Now().UTC(),
+		Type:      typeName(content),
+		Codec:     store.Codec.Name(),
+	}
+	encoded, err := store.Codec.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Content = encoded
+
+	value, err := marshalRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(value, encoded) {
+		t.Errorf("expected the envelope to carry Content verbatim, got %q around %q", value, encoded)
+	}
+
+	decoded, err := unmarshalRecord(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("expected unmarshalRecord to round-trip the record, got %+v, want %+v", decoded, record)
+	}
+}
+
+func TestBadgerEventStore_CodecMigration(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.codec"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Codec = NewJSONCodec()
+	store.Register(Test{})
+
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, err := store.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected events written under both codecs to be readable, got %d", len(results))
+	}
+	if !reflect.DeepEqual(results[0], Test{Value: 1}) || !reflect.DeepEqual(results[1], Test{Value: 2}) {
+		t.Errorf("unexpected content across a codec migration: %v", results)
+	}
+}
+
+func TestBadgerEventStore_SnapshotAndCompact(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.snapshot"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.ListKeysForAggregate(fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptoID, err := ulid.ParseStrict(keys[len(keys)-1][len(fact)+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Snapshot(fact, Test{Value: 2}, uptoID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Append(fact, Test{Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, events, err := store.ReadFrom(fact, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot, Test{Value: 2}) {
+		t.Errorf("expected snapshot \"%v\", but received \"%v\"", Test{Value: 2}, snapshot)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], Test{Value: 3}) {
+		t.Errorf("expected only the post-snapshot event, got %v", events)
+	}
+
+	if err := store.Compact(fact, uptoID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, allEvents, err := store.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allEvents) != 1 || !reflect.DeepEqual(allEvents[0], Test{Value: 3}) {
+		t.Errorf("expected compaction to leave only the post-snapshot event, got %v", allEvents)
+	}
+}
+
+// countingCodec wraps a GobCodec to count Unmarshal calls, so a test can
+// assert ReadFrom decoded exactly the records it should have.
+type countingCodec struct {
+	*GobCodec
+	unmarshals int
+}
+
+func (c *countingCodec) Unmarshal(data []byte, typeName string) (interface{}, error) {
+	c.unmarshals++
+	return c.GobCodec.Unmarshal(data, typeName)
+}
+
+func TestBadgerEventStore_ReadFromSinceSnapshotSkipsPriorEvents(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	codec := &countingCodec{GobCodec: NewGobCodec()}
+	store.Codec = codec
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.snapshot.skip"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.ListKeysForAggregate(fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptoID, err := ulid.ParseStrict(keys[len(keys)-1][len(fact)+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Snapshot(fact, Test{Value: 2}, uptoID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sleep so the next event's ULID unambiguously sorts after uptoID: ULIDs
+	// minted in the same millisecond aren't guaranteed to sort by generation
+	// order, which ReadFrom's snapshot seek relies on.
+	time.Sleep(time.Millisecond)
+	if err := store.Append(fact, Test{Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	codec.unmarshals = 0
+	_, events, err := store.ReadFrom(fact, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], Test{Value: 3}) {
+		t.Fatalf("expected only the post-snapshot event, got %v", events)
+	}
+	// One decode for the snapshot content, one for the post-snapshot event.
+	// If ReadFrom were still scanning from the aggregate's start, the two
+	// pre-snapshot events would add two more.
+	if codec.unmarshals != 2 {
+		t.Errorf("expected ReadFrom to decode only the snapshot and the post-snapshot event, got %d decodes", codec.unmarshals)
+	}
+}
+
+func TestBadgerEventStore_CompactionThresholdAutoCompacts(t *testing.T) {
+	store := MemoryStore().(*BadgerEventStore)
+	store.CompactionThreshold = 2
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.autocompact"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.ListKeysForAggregate(fact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptoID, err := ulid.ParseStrict(keys[len(keys)-1][len(fact)+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Snapshot(fact, Test{Value: 1}, uptoID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first of these appends brings the count to CompactionThreshold and
+	// should schedule a background Compact down to the snapshot above; the
+	// count then restarts from zero, so the second append does not trigger
+	// another one.
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(fact, Test{Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		keys, err := store.ListKeysForAggregate(fact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) <= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for auto-compaction, aggregate still has keys %v", keys)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, events, err := store.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected auto-compaction to leave only the post-snapshot events, got %v", events)
+	}
+}
+
+func TestBadgerEventStore_BackupRestore(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.backup"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	if _, err := store.Backup(&dump, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := MemoryStore()
+	defer func() {
+		if err := restored.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	restored.Register(Test{})
+
+	if err := restored.Restore(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, err := restored.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 events after restore, got %d", len(results))
+	}
+	if !reflect.DeepEqual(results[0], Test{Value: 1}) || !reflect.DeepEqual(results[1], Test{Value: 2}) {
+		t.Errorf("unexpected content after restore: %v", results)
+	}
+
+	if err := restored.Restore(bytes.NewReader([]byte("not a backup\n"))); err == nil {
+		t.Error("expected Restore to reject a dump with a bad header")
+	}
+}
+
+func TestBadgerEventStore_StreamTo(t *testing.T) {
+	source := MemoryStore()
+	defer func() {
+		if err := source.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	source.Register(Test{})
+	fact := "test.stream"
+
+	if err := source.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Append("test.stream.other", Test{Value: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	remote := MemoryStore()
+	defer func() {
+		if err := remote.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	remote.Register(Test{})
+
+	if err := source.(*BadgerEventStore).StreamTo(context.Background(), remote, []string{fact}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, results, err := remote.ReadFrom(fact, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 streamed events, got %d", len(results))
+	}
+	if !reflect.DeepEqual(results[0], Test{Value: 1}) || !reflect.DeepEqual(results[1], Test{Value: 2}) {
+		t.Errorf("unexpected content after StreamTo: %v", results)
+	}
+
+	if _, _, err := remote.ReadFrom("test.stream.other", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, results, err := remote.ReadFrom("test.stream.other", false); err != nil || len(results) != 0 {
+		t.Errorf("expected StreamTo to skip aggregates outside the requested list, got %v, %v", results, err)
+	}
+}
+
+func TestBadgerEventStore_Subscribe(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.subscribe"
+
+	if err := store.Append(fact, Test{Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := store.Subscribe(ctx, fact, ulid.ULID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-events
+	if first.Err != nil {
+		t.Fatalf("unexpected error replaying subscription: %s", first.Err)
+	}
+	if !reflect.DeepEqual(first.Content, Test{Value: 1}) {
+		t.Errorf("expected replayed content \"%v\", but received \"%v\"", Test{Value: 1}, first.Content)
+	}
+
+	if err := store.Append(fact, Test{Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case second := <-events:
+		if second.Err != nil {
+			t.Fatalf("unexpected error on live append: %s", second.Err)
+		}
+		if !reflect.DeepEqual(second.Content, Test{Value: 2}) {
+			t.Errorf("expected live content \"%v\", but received \"%v\"", Test{Value: 2}, second.Content)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for live append")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected channel to be closed after context cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for subscription channel to close")
+	}
+}
+
+func TestBadgerEventStore_SubscribeConcurrentAppend(t *testing.T) {
+	store := MemoryStore()
+	defer func() {
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	store.Register(Test{})
+	fact := "test.subscribe.concurrent"
+
+	const replayed = 50
+	for i := 0; i < replayed; i++ {
+		if err := store.Append(fact, Test{Value: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := store.Subscribe(ctx, fact, ulid.ULID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Append(fact, Test{Value: replayed}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+	var got []int
+	for len(got) < replayed+1 {
+		select {
+		case event := <-events:
+			if event.Err != nil {
+				t.Fatalf("unexpected error: %s", event.Err)
+			}
+			v := event.Content.(Test).Value
+			if seen[v] {
+				t.Fatalf("event %d delivered twice: %v", v, got)
+			}
+			seen[v] = true
+			got = append(got, v)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d of %d events", len(got), replayed+1)
+		}
+	}
+
+	if got[len(got)-1] != replayed {
+		t.Fatalf("expected the live append to be delivered last, after the full replay, got %v", got)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes and decodes event content for storage. BadgerEventStore
+// persists a Record's Codec.Name() in its header, so a store can keep
+// decoding records written by a codec it no longer writes with while a
+// migration to a new one is in progress.
+type Codec interface {
+	// Marshal encodes v to its wire representation.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into an instance of the type registered under typeName.
+	Unmarshal(data []byte, typeName string) (interface{}, error)
+	// Name identifies the codec in a Record's header.
+	Name() string
+}
+
+// gobCodecName is also the implicit codec of any Record written before Codec
+// existed, since BadgerEventStore hardcoded gob at the time.
+const gobCodecName = "gob"
+
+// GobCodec encodes content with encoding/gob, the format BadgerEventStore
+// used before Codec was introduced.
+type GobCodec struct {
+	types map[string]reflect.Type
+}
+
+func NewGobCodec() *GobCodec {
+	return &GobCodec{types: make(map[string]reflect.Type)}
+}
+
+// Register makes t decodable by name, mirroring gob's own registration.
+func (c *GobCodec) Register(t interface{}) {
+	gob.Register(t)
+	c.types[typeName(t)] = reflect.TypeOf(t)
+}
+
+func (c *GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *GobCodec) Unmarshal(data []byte, name string) (interface{}, error) {
+	t, ok := c.types[name]
+	if !ok {
+		return nil, fmt.Errorf("eventstore: gob codec has no type registered for %q", name)
+	}
+
+	v := reflect.New(t).Elem().Interface()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *GobCodec) Name() string {
+	return gobCodecName
+}
+
+// JSONCodec encodes content with encoding/json, which is less compact than
+// gob but produces records a non-Go consumer can read directly.
+type JSONCodec struct {
+	types map[string]reflect.Type
+}
+
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{types: make(map[string]reflect.Type)}
+}
+
+// Register makes t decodable by name.
+func (c *JSONCodec) Register(t interface{}) {
+	c.types[typeName(t)] = reflect.TypeOf(t)
+}
+
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c *JSONCodec) Unmarshal(data []byte, name string) (interface{}, error) {
+	t, ok := c.types[name]
+	if !ok {
+		return nil, fmt.Errorf("eventstore: json codec has no type registered for %q", name)
+	}
+
+	v := reflect.New(t).Interface()
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+func (c *JSONCodec) Name() string {
+	return "json"
+}
+
+// ProtoCodec encodes content with Protobuf. It keeps a registry of
+// factories rather than reflect.Type, since a proto.Message can't be
+// constructed generically the way a plain Go struct can.
+type ProtoCodec struct {
+	factories map[string]func() proto.Message
+}
+
+func NewProtoCodec() *ProtoCodec {
+	return &ProtoCodec{factories: make(map[string]func() proto.Message)}
+}
+
+// RegisterFactory maps a type name to a factory that produces a new, empty
+// instance of the proto.Message to decode into.
+func (c *ProtoCodec) RegisterFactory(name string, factory func() proto.Message) {
+	c.factories[name] = factory
+}
+
+func (c *ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("eventstore: proto codec cannot marshal %T, it does not implement proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (c *ProtoCodec) Unmarshal(data []byte, name string) (interface{}, error) {
+	factory, ok := c.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("eventstore: proto codec has no factory registered for %q", name)
+	}
+
+	msg := factory()
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c *ProtoCodec) Name() string {
+	return "proto"
+}
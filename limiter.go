@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// emaAlpha weights how quickly a Limiter's throughput estimate reacts to a
+// new sample; lower smooths more, higher tracks bursts more closely.
+const emaAlpha = 0.2
+
+// Limiter is a token-bucket rate limiter, modeled on the classic
+// monitor/limiter flowcontrol pattern: a capped bucket of tokens refills at
+// a steady rate, callers wait for enough tokens to cover their request, and
+// an exponential moving average tracks realized throughput for Stats.
+type Limiter struct {
+	mu         sync.Mutex
+	ratePerSec float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+	emaRate    float64
+	lastEvent  time.Time
+	pending    int64
+}
+
+// NewLimiter creates a Limiter allowing ratePerSec sustained throughput
+// (bytes or operations, whatever the caller counts) with bursts up to burst.
+func NewLimiter(ratePerSec int64, burst int) *Limiter {
+	now := time.Now()
+	return &Limiter{
+		ratePerSec: float64(ratePerSec),
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastRefill: now,
+		lastEvent:  now,
+	}
+}
+
+// Wait blocks until n tokens are available or ctx is done. A request for
+// more than the limiter's burst is capped to the burst size, so it is
+// granted once the bucket is full rather than blocking forever.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	atomic.AddInt64(&l.pending, 1)
+	defer atomic.AddInt64(&l.pending, -1)
+
+	need := float64(n)
+	if need > l.burst {
+		need = l.burst
+	}
+
+	for {
+		l.mu.Lock()
+		l.refill()
+		if l.tokens >= need {
+			l.tokens -= need
+			l.mu.Unlock()
+			break
+		}
+		wait := time.Duration((need - l.tokens) / l.ratePerSec * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	l.record(n)
+	return nil
+}
+
+// refill adds tokens for the time elapsed since the last refill. Callers
+// must hold l.mu.
+func (l *Limiter) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.lastRefill).Seconds() * l.ratePerSec
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.lastRefill = now
+}
+
+// record folds n units observed since the last call into the EMA throughput
+// estimate.
+func (l *Limiter) record(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.lastEvent).Seconds()
+	l.lastEvent = now
+	if elapsed <= 0 {
+		elapsed = 0.001
+	}
+
+	instant := float64(n) / elapsed
+	l.emaRate = emaAlpha*instant + (1-emaAlpha)*l.emaRate
+}
+
+// LimiterStats reports a Limiter's current estimated throughput and the
+// number of callers presently blocked in Wait.
+type LimiterStats struct {
+	EMARate float64
+	Pending int64
+}
+
+// Stats returns the limiter's current EMA throughput and pending-wait count.
+func (l *Limiter) Stats() LimiterStats {
+	if l == nil {
+		return LimiterStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		EMARate: l.emaRate,
+		Pending: atomic.LoadInt64(&l.pending),
+	}
+}
@@ -16,18 +16,72 @@
 
 package eventstore
 
+import (
+	"context"
+	"io"
+
+	"github.com/oklog/ulid/v2"
+)
+
 // EventStore provides an interface to store events for a topic, and retrieve them later.
 type EventStore interface {
 	// Register a type for deserialization
 	Register(t interface{})
 	// Append append an event to the event store for the fact
 	Append(aggregate string, content interface{}) error
-	// Read the events for a fact from the beginning
-	Read(aggregate string) ([]interface{}, error)
+	// AppendCtx is Append, but honoring ctx while it waits on a configured
+	// write rate limit instead of blocking unconditionally.
+	AppendCtx(ctx context.Context, aggregate string, content interface{}) error
+	// AppendExpected atomically appends events to aggregate only if its
+	// current version matches expectedVersion, returning the version after
+	// the append. It returns ErrConcurrencyConflict if another writer has
+	// advanced the aggregate past expectedVersion.
+	AppendExpected(aggregate string, expectedVersion uint64, events ...interface{}) (newVersion uint64, err error)
+	// AppendExpectedCtx is AppendExpected, but honoring ctx while it waits on
+	// a configured write rate limit instead of blocking unconditionally.
+	AppendExpectedCtx(ctx context.Context, aggregate string, expectedVersion uint64, events ...interface{}) (newVersion uint64, err error)
+	// Version returns the current version of an aggregate as maintained by
+	// AppendExpected, without replaying its event history.
+	Version(aggregate string) (uint64, error)
+	// ReadFrom reads the events for an aggregate. When sinceSnapshot is true
+	// it starts from the Snapshot with the greatest uptoID, returning that
+	// snapshot and only the events after it;
+	// otherwise snapshot is nil and events covers the full history.
+	ReadFrom(aggregate string, sinceSnapshot bool) (snapshot interface{}, events []interface{}, err error)
+	// Snapshot stores a point-in-time aggregate state as of uptoID, so
+	// ReadFrom and Compact can treat it as the new starting point.
+	Snapshot(aggregate string, state interface{}, uptoID ulid.ULID) error
+	// Compact deletes events for an aggregate at or before keepAfter,
+	// typically the ID of a recent Snapshot, in a single transaction.
+	Compact(aggregate string, keepAfter ulid.ULID) error
+	// Subscribe tails an aggregate for live updates. It first replays any
+	// records with keys strictly greater than fromID, then blocks delivering
+	// events as they are appended until ctx is cancelled or the store is
+	// closed. A subscriber that cannot keep up with the buffer is dropped
+	// and receives a final Event with Err set before its channel is closed.
+	Subscribe(ctx context.Context, aggregate string, fromID ulid.ULID) (<-chan Event, error)
 	// ListKeys will list all keys in the store
 	ListKeys() ([]string, error)
 	// ListKeysForAggregate will list all keys with the aggregate prefix
 	ListKeysForAggregate(aggregate string) ([]string, error)
+	// Backup writes a versioned dump of all records with a Badger sequence
+	// number greater than since to w, returning the high-water sequence to
+	// pass as since on the next incremental Backup (0 for a full backup).
+	Backup(w io.Writer, since uint64) (uint64, error)
+	// Restore loads a dump written by Backup into this store, rejecting
+	// dumps whose header isn't a compatible eventstore backup.
+	Restore(r io.Reader) error
+	// StreamTo ships aggregates (all aggregates if empty) to remote using
+	// Badger's Stream framework, for warm standby replication.
+	StreamTo(ctx context.Context, remote EventStore, aggregates []string) error
 	// Close the event store
 	Close() error
 }
+
+// Event is delivered on a Subscribe channel. Err is set, and Content is nil,
+// when the subscriber fell behind and was dropped.
+type Event struct {
+	Id      ulid.ULID
+	Content interface{}
+	Err     error
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2021.  D-Haven.org
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/ristretto/z"
+)
+
+// backupMagic identifies a Backup dump as belonging to this store, so
+// Restore can reject an arbitrary file before handing it to Badger's loader.
+const backupMagic = "eventstore-backup"
+
+// backupSchemaVersion guards against loading a dump written by an
+// incompatible future or past version of the backup header.
+const backupSchemaVersion = 1
+
+// backupHeader is written as a single JSON line before the raw Badger
+// backup stream, so Restore can validate a dump before attempting to load it.
+type backupHeader struct {
+	Magic   string
+	Codec   string
+	Version int
+}
+
+// Backup writes a versioned dump of all records with a Badger sequence
+// number greater than since to w, using Badger's own backup format for the
+// bulk of the stream. Pass the returned sequence as since on the next
+// incremental Backup, or 0 for a full backup.
+func (b *BadgerEventStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	db, err := b.kvstore()
+	if err != nil {
+		return 0, err
+	}
+
+	header := backupHeader{
+		Magic:   backupMagic,
+		Codec:   b.activeCodec().Name(),
+		Version: backupSchemaVersion,
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+	headerBytes = append(headerBytes, '\n')
+
+	if _, err := w.Write(headerBytes); err != nil {
+		return 0, err
+	}
+
+	// db.Backup also dumps entries whose version equals its argument, so
+	// start one past since to dump only what is newer.
+	if since > 0 {
+		since++
+	}
+	return db.Backup(w, since)
+}
+
+// Restore loads a dump written by Backup into this store, rejecting dumps
+// whose header isn't a compatible eventstore backup.
+func (b *BadgerEventStore) Restore(r io.Reader) error {
+	db, err := b.kvstore()
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+	line, err := buffered.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("eventstore: reading backup header: %w", err)
+	}
+
+	var header backupHeader
+	if err := json.Unmarshal([]byte(line), &header); err != nil {
+		return fmt.Errorf("eventstore: not an eventstore backup: %w", err)
+	}
+	if header.Magic != backupMagic {
+		return fmt.Errorf("eventstore: not an eventstore backup (bad magic %q)", header.Magic)
+	}
+	if header.Version != backupSchemaVersion {
+		return fmt.Errorf("eventstore: unsupported backup schema version %d, want %d", header.Version, backupSchemaVersion)
+	}
+
+	return db.Load(buffered, 256)
+}
+
+// StreamTo ships aggregates (all aggregates if empty) to remote using
+// Badger's Stream framework, copying key ranges directly rather than
+// replaying through Append. remote must be a *BadgerEventStore so its
+// underlying Badger instance can be written to directly; this is the
+// building block for warm standby and cross-instance replication.
+func (b *BadgerEventStore) StreamTo(ctx context.Context, remote EventStore, aggregates []string) error {
+	target, ok := remote.(*BadgerEventStore)
+	if !ok {
+		return fmt.Errorf("eventstore: StreamTo requires a *BadgerEventStore remote, got %T", remote)
+	}
+
+	db, err := b.kvstore()
+	if err != nil {
+		return err
+	}
+
+	remoteDB, err := target.kvstore()
+	if err != nil {
+		return err
+	}
+
+	prefixes := make([][]byte, len(aggregates))
+	for i, aggregate := range aggregates {
+		prefixes[i] = []byte(aggregate + ":")
+	}
+
+	stream := db.NewStream()
+	stream.LogPrefix = "eventstore.StreamTo"
+
+	if len(prefixes) > 0 {
+		stream.ChooseKey = func(item *badger.Item) bool {
+			for _, prefix := range prefixes {
+				if bytes.HasPrefix(item.Key(), prefix) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	stream.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+
+		return remoteDB.Update(func(txn *badger.Txn) error {
+			for _, kv := range list.Kv {
+				if err := txn.Set(kv.Key, kv.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return stream.Orchestrate(ctx)
+}